@@ -0,0 +1,229 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ManifestFormat identifies the on-disk layout used when generating the
+// manifest for a CatalogSourceConfig.
+type ManifestFormat string
+
+const (
+	// RegistryV1ManifestFormat is the legacy operator-registry manifest
+	// format produced by catalogsourceconfig.NewManifest. It is used when
+	// Format is left empty, so existing CatalogSourceConfigs keep their
+	// current on-disk layout.
+	RegistryV1ManifestFormat ManifestFormat = "registry+v1"
+
+	// FBCManifestFormat is the file-based catalog format produced by
+	// catalogsourceconfig.NewFBCManifest, consumed by opm and catalogd.
+	FBCManifestFormat ManifestFormat = "fbc"
+)
+
+// ConfigMapPrefix is prepended to a CatalogSourceConfig's name to get the
+// name of the ConfigMap generated for it in spec.targetNamespace.
+const ConfigMapPrefix = "catsrc-cm-"
+
+// ManifestCreationMode selects how the controller reacts to an invalid CSV
+// while generating a CatalogSourceConfig's manifest.
+type ManifestCreationMode string
+
+const (
+	// StrictFailFastMode stops at the first invalid CSV and reports an
+	// error, publishing no bundles. This is the default, and is the only
+	// mode supported when Format is FBCManifestFormat.
+	StrictFailFastMode ManifestCreationMode = "StrictFailFast"
+
+	// BestEffortSkipInvalidMode skips invalid CSVs and publishes the rest,
+	// recording the skipped CSVs in status.bundleOutcomes. Only supported
+	// when Format is RegistryV1ManifestFormat.
+	BestEffortSkipInvalidMode ManifestCreationMode = "BestEffortSkipInvalid"
+)
+
+// CatalogSourceConfigSpec defines the desired state of CatalogSourceConfig
+type CatalogSourceConfigSpec struct {
+	// TargetNamespace is the namespace where the generated ConfigMap and
+	// CatalogSource are created.
+	TargetNamespace string `json:"targetNamespace"`
+
+	// Format selects the on-disk manifest layout generated for this
+	// CatalogSourceConfig's package. Defaults to RegistryV1ManifestFormat.
+	// +optional
+	Format ManifestFormat `json:"format,omitempty"`
+
+	// Bundles is an optional list of operator bundle images to populate
+	// this CatalogSourceConfig's package from, pulled directly from a
+	// container registry instead of scraped from an OperatorSource
+	// app-registry.
+	// +optional
+	Bundles []BundleReference `json:"bundles,omitempty"`
+
+	// Mode selects how the controller reacts to an invalid CSV while
+	// generating the manifest. Defaults to StrictFailFastMode.
+	// +optional
+	Mode ManifestCreationMode `json:"mode,omitempty"`
+}
+
+// BundleReference identifies a single operator bundle image to pull
+// directly from a container registry.
+type BundleReference struct {
+	// Image is the bundle image reference, e.g.
+	// quay.io/example/etcd-bundle:v0.9.2.
+	Image string `json:"image"`
+
+	// PullSecret is the name of a Secret of type
+	// kubernetes.io/dockerconfigjson in the CatalogSourceConfig's namespace,
+	// used to authenticate to the registry hosting Image.
+	// +optional
+	PullSecret string `json:"pullSecret,omitempty"`
+
+	// DigestPinned requires that Image resolve to a digest reference rather
+	// than a mutable tag.
+	// +optional
+	DigestPinned bool `json:"digestPinned,omitempty"`
+}
+
+// CatalogSourceConfigStatus defines the observed state of CatalogSourceConfig
+type CatalogSourceConfigStatus struct {
+	// Message conveys the result of the most recent reconcile.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// BundleOutcomes reports the per-CSV result of the most recent successful
+	// manifest creation when spec.format is RegistryV1ManifestFormat (or
+	// empty). Under StrictFailFastMode every listed CSV was published, since
+	// an invalid CSV fails the reconcile and leaves this field unchanged;
+	// under BestEffortSkipInvalidMode skipped CSVs are listed with Skipped
+	// set. It is not populated when spec.format is FBCManifestFormat.
+	// +optional
+	BundleOutcomes []BundleOutcome `json:"bundleOutcomes,omitempty"`
+}
+
+// BundleOutcome reports whether a single CSV's bundle was published or
+// skipped while generating a CatalogSourceConfig's manifest.
+type BundleOutcome struct {
+	// CSVName is the name of the CSV this outcome is for.
+	CSVName string `json:"csvName"`
+
+	// Skipped is true if the CSV was invalid and was not published.
+	// +optional
+	Skipped bool `json:"skipped,omitempty"`
+
+	// Message is the error encountered while creating the bundle for this
+	// CSV, if Skipped is true.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// CatalogSourceConfig is the Schema for the catalogsourceconfigs API
+type CatalogSourceConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CatalogSourceConfigSpec   `json:"spec,omitempty"`
+	Status CatalogSourceConfigStatus `json:"status,omitempty"`
+}
+
+// CatalogSourceConfigList contains a list of CatalogSourceConfig
+type CatalogSourceConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatalogSourceConfig `json:"items"`
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *CatalogSourceConfigSpec) DeepCopyInto(out *CatalogSourceConfigSpec) {
+	*out = *in
+	if in.Bundles != nil {
+		out.Bundles = make([]BundleReference, len(in.Bundles))
+		copy(out.Bundles, in.Bundles)
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver.
+func (in *CatalogSourceConfigSpec) DeepCopy() *CatalogSourceConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogSourceConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *CatalogSourceConfigStatus) DeepCopyInto(out *CatalogSourceConfigStatus) {
+	*out = *in
+	if in.BundleOutcomes != nil {
+		out.BundleOutcomes = make([]BundleOutcome, len(in.BundleOutcomes))
+		copy(out.BundleOutcomes, in.BundleOutcomes)
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver.
+func (in *CatalogSourceConfigStatus) DeepCopy() *CatalogSourceConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogSourceConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *CatalogSourceConfig) DeepCopyInto(out *CatalogSourceConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy of the receiver.
+func (in *CatalogSourceConfig) DeepCopy() *CatalogSourceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogSourceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *CatalogSourceConfig) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *CatalogSourceConfigList) DeepCopyInto(out *CatalogSourceConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]CatalogSourceConfig, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the receiver.
+func (in *CatalogSourceConfigList) DeepCopy() *CatalogSourceConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(CatalogSourceConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *CatalogSourceConfigList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	return in.DeepCopy()
+}
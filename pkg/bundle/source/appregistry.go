@@ -0,0 +1,28 @@
+package source
+
+import (
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+)
+
+// appRegistryUnpacker is the Unpacker that backs the existing behavior: the
+// bundle contents were already scraped from an OperatorSource app-registry
+// and written into the in-memory Writer/Reader by the appregistry client, so
+// Unpack is just a lookup by package ID.
+type appRegistryUnpacker struct {
+	reader    datastore.Reader
+	packageID string
+}
+
+// NewAppRegistryUnpacker returns an Unpacker that reads a package already
+// present in reader, having been populated from an OperatorSource
+// app-registry.
+func NewAppRegistryUnpacker(reader datastore.Reader, packageID string) Unpacker {
+	return &appRegistryUnpacker{
+		reader:    reader,
+		packageID: packageID,
+	}
+}
+
+func (u *appRegistryUnpacker) Unpack() (*datastore.SingleOperatorManifest, error) {
+	return u.reader.ReadSingle(u.packageID)
+}
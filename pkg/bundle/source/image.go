@@ -0,0 +1,229 @@
+package source
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+)
+
+const (
+	// manifestsDir is the directory inside a registry+v1 bundle image that
+	// holds the CSV and owned CRD YAMLs.
+	manifestsDir = "manifests/"
+
+	// annotationsFile is the path inside a registry+v1 bundle image of the
+	// bundle metadata, per the operator-registry bundle format.
+	annotationsFile = "metadata/annotations.yaml"
+
+	annotationPackage        = "operators.operatorframework.io.bundle.package.v1"
+	annotationChannels       = "operators.operatorframework.io.bundle.channels.v1"
+	annotationDefaultChannel = "operators.operatorframework.io.bundle.channel.default.v1"
+)
+
+// bundleAnnotations mirrors the annotations.yaml written alongside a
+// registry+v1 bundle, per the operator-registry bundle format.
+type bundleAnnotations struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// imageUnpacker is the Unpacker that resolves a bundle image reference,
+// pulls it directly from the registry, and reads the bundle contents out of
+// its layers without shelling out to skopeo or podman.
+type imageUnpacker struct {
+	image      string
+	keychain   authn.Keychain
+	digestOnly bool
+}
+
+// ImageUnpackerOption configures an imageUnpacker returned by
+// NewImageUnpacker.
+type ImageUnpackerOption func(*imageUnpacker)
+
+// WithKeychain configures the authn.Keychain used to authenticate to the
+// registry, for bundle images that require a pull secret.
+func WithKeychain(keychain authn.Keychain) ImageUnpackerOption {
+	return func(u *imageUnpacker) {
+		u.keychain = keychain
+	}
+}
+
+// WithDigestPinning requires that image resolve to a digest reference
+// (name:tag@sha256:...) rather than a mutable tag, so the same bytes are
+// unpacked on every reconcile.
+func WithDigestPinning() ImageUnpackerOption {
+	return func(u *imageUnpacker) {
+		u.digestOnly = true
+	}
+}
+
+// NewImageUnpacker returns an Unpacker that pulls the bundle image and reads
+// its manifests/ and metadata/annotations.yaml directly from the registry.
+func NewImageUnpacker(image string, opts ...ImageUnpackerOption) Unpacker {
+	u := &imageUnpacker{
+		image:    image,
+		keychain: authn.DefaultKeychain,
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+func (u *imageUnpacker) Unpack() (*datastore.SingleOperatorManifest, error) {
+	ref, err := name.ParseReference(u.image)
+	if err != nil {
+		return nil, fmt.Errorf("Error %s parsing bundle image reference %s", err, u.image)
+	}
+	if u.digestOnly {
+		if _, ok := ref.(name.Digest); !ok {
+			return nil, fmt.Errorf("Bundle image %s must be pinned to a digest", u.image)
+		}
+	}
+
+	img, err := remote.Image(ref, remote.WithAuthFromKeychain(u.keychain))
+	if err != nil {
+		return nil, fmt.Errorf("Error %s pulling bundle image %s", err, u.image)
+	}
+
+	files, err := readImageFiles(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildSingleOperatorManifest(files)
+}
+
+// readImageFiles flattens every layer of img into a single map of file path
+// to file contents, with later layers overwriting earlier ones, mirroring
+// how the image's filesystem looks once fully extracted.
+func readImageFiles(img v1.Image) (map[string][]byte, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("Error %s reading bundle image layers", err)
+	}
+
+	files := map[string][]byte{}
+	for _, layer := range layers {
+		rc, err := layer.Uncompressed()
+		if err != nil {
+			return nil, fmt.Errorf("Error %s uncompressing bundle image layer", err)
+		}
+
+		tr := tar.NewReader(rc)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rc.Close()
+				return nil, fmt.Errorf("Error %s reading bundle image layer", err)
+			}
+
+			filePath := strings.TrimPrefix(header.Name, "/")
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if !strings.HasPrefix(filePath, manifestsDir) && filePath != annotationsFile {
+				continue
+			}
+
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				rc.Close()
+				return nil, fmt.Errorf("Error %s reading %s from bundle image layer", err, filePath)
+			}
+			files[filePath] = content
+		}
+		rc.Close()
+	}
+	return files, nil
+}
+
+// buildSingleOperatorManifest parses the CSV and owned CRD YAMLs under
+// manifests/ plus metadata/annotations.yaml into a SingleOperatorManifest.
+func buildSingleOperatorManifest(files map[string][]byte) (*datastore.SingleOperatorManifest, error) {
+	rawAnnotations, found := files[annotationsFile]
+	if !found {
+		return nil, fmt.Errorf("Bundle image is missing %s", annotationsFile)
+	}
+	var annotations bundleAnnotations
+	if err := yaml.Unmarshal(rawAnnotations, &annotations); err != nil {
+		return nil, fmt.Errorf("Error %s parsing %s", err, annotationsFile)
+	}
+	packageID := annotations.Annotations[annotationPackage]
+	if packageID == "" {
+		return nil, fmt.Errorf("%s is missing the %s annotation", annotationsFile, annotationPackage)
+	}
+	defaultChannel := annotations.Annotations[annotationDefaultChannel]
+	if defaultChannel == "" {
+		return nil, fmt.Errorf("%s is missing the %s annotation", annotationsFile, annotationDefaultChannel)
+	}
+	var channelNames []string
+	for _, channelName := range strings.Split(annotations.Annotations[annotationChannels], ",") {
+		channelName = strings.TrimSpace(channelName)
+		if channelName != "" {
+			channelNames = append(channelNames, channelName)
+		}
+	}
+	if len(channelNames) == 0 {
+		return nil, fmt.Errorf("%s is missing the %s annotation", annotationsFile, annotationChannels)
+	}
+
+	var csvs []*datastore.ClusterServiceVersion
+	var crds []*datastore.CustomResourceDefinition
+	for file, raw := range files {
+		if !strings.HasPrefix(file, manifestsDir) {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(path.Base(file), ".clusterserviceversion.yaml"),
+			strings.HasSuffix(path.Base(file), ".csv.yaml"):
+			csv, err := datastore.NewClusterServiceVersion(raw)
+			if err != nil {
+				return nil, fmt.Errorf("Error %s parsing CSV %s", err, file)
+			}
+			csvs = append(csvs, csv)
+		case strings.HasSuffix(path.Base(file), ".crd.yaml"):
+			crd, err := datastore.NewCustomResourceDefinition(raw)
+			if err != nil {
+				return nil, fmt.Errorf("Error %s parsing CRD %s", err, file)
+			}
+			crds = append(crds, crd)
+		}
+	}
+	if len(csvs) == 0 {
+		return nil, fmt.Errorf("Bundle image contains no CSV under %s", manifestsDir)
+	}
+
+	// A bundle image contains a single CSV, which is the current head of
+	// every channel it was annotated as belonging to.
+	csvName := csvs[0].GetName()
+	channels := make([]datastore.PackageChannel, len(channelNames))
+	for i, channelName := range channelNames {
+		channels[i] = datastore.PackageChannel{
+			Name:           channelName,
+			CurrentCSVName: csvName,
+		}
+	}
+
+	return &datastore.SingleOperatorManifest{
+		Package: datastore.Package{
+			PackageName:        packageID,
+			DefaultChannelName: defaultChannel,
+			Channels:           channels,
+		},
+		ClusterServiceVersions:    csvs,
+		CustomResourceDefinitions: crds,
+	}, nil
+}
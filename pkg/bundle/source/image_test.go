@@ -0,0 +1,94 @@
+package source_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/operator-framework/operator-marketplace/pkg/bundle/source"
+	"github.com/stretchr/testify/require"
+)
+
+const annotationsYAML = `
+annotations:
+  operators.operatorframework.io.bundle.mediatype.v1: registry+v1
+  operators.operatorframework.io.bundle.package.v1: etcd
+  operators.operatorframework.io.bundle.channels.v1: alpha
+  operators.operatorframework.io.bundle.channel.default.v1: alpha
+`
+
+const csvYAML = `
+apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: etcdoperator.v0.9.2
+spec:
+  version: 0.9.2
+`
+
+// TestImageUnpackerUnpack pulls a synthetic registry+v1 bundle image from an
+// in-memory fake registry and checks that the CSV and package ID are
+// recovered correctly.
+func TestImageUnpackerUnpack(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	image := pushTestImage(t, server.URL, map[string]string{
+		"manifests/etcdoperator.v0.9.2.clusterserviceversion.yaml": csvYAML,
+		"metadata/annotations.yaml":                                annotationsYAML,
+	})
+
+	unpacker := source.NewImageUnpacker(image)
+	sm, err := unpacker.Unpack()
+	require.NoError(t, err)
+	require.Len(t, sm.ClusterServiceVersions, 1)
+	require.Equal(t, "etcd", sm.Package.PackageName)
+	require.Equal(t, "alpha", sm.Package.DefaultChannelName)
+	require.Len(t, sm.Package.Channels, 1)
+	require.Equal(t, "alpha", sm.Package.Channels[0].Name)
+	require.Equal(t, sm.ClusterServiceVersions[0].GetName(), sm.Package.Channels[0].CurrentCSVName)
+}
+
+// pushTestImage builds a single layer tarball containing files and pushes it
+// to the fake registry at serverURL, returning the image reference.
+func pushTestImage(t *testing.T, serverURL string, files map[string]string) string {
+	ref, err := name.ParseReference(serverURL[len("http://"):] + "/bundle:v0.9.2")
+	require.NoError(t, err)
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return newTarReadCloser(files), nil
+	})
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	require.NoError(t, remote.Write(ref, img))
+	return ref.Name()
+}
+
+func newTarReadCloser(files map[string]string) io.ReadCloser {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+		_ = tw.WriteHeader(hdr)
+		_, _ = tw.Write([]byte(content))
+	}
+	_ = tw.Close()
+	return readCloser{bytes.NewReader(buf.Bytes())}
+}
+
+type readCloser struct {
+	*bytes.Reader
+}
+
+func (readCloser) Close() error { return nil }
@@ -0,0 +1,41 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// dockerConfigJSON mirrors the .dockerconfigjson payload of a
+// kubernetes.io/dockerconfigjson Secret.
+type dockerConfigJSON struct {
+	Auths map[string]authn.AuthConfig `json:"auths"`
+}
+
+// dockerConfigKeychain is an authn.Keychain backed by a parsed
+// .dockerconfigjson pull secret.
+type dockerConfigKeychain struct {
+	auths map[string]authn.AuthConfig
+}
+
+// NewKeychainFromDockerConfigJSON returns an authn.Keychain backed by the
+// registry credentials in data, the .dockerconfigjson payload of a
+// kubernetes.io/dockerconfigjson Secret referenced by a
+// CatalogSourceConfig's spec.bundles[].pullSecret.
+func NewKeychainFromDockerConfigJSON(data []byte) (authn.Keychain, error) {
+	var cfg dockerConfigJSON
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("Error %s parsing .dockerconfigjson", err)
+	}
+	return &dockerConfigKeychain{auths: cfg.Auths}, nil
+}
+
+// Resolve implements authn.Keychain.
+func (k *dockerConfigKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	auth, found := k.auths[target.RegistryStr()]
+	if !found {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(auth), nil
+}
@@ -0,0 +1,17 @@
+// Package source provides pluggable ways of obtaining the contents of an
+// operator bundle as a datastore.SingleOperatorManifest, whether that bundle
+// lives in an OperatorSource app-registry or in a bundle image on a
+// container registry.
+package source
+
+import (
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+)
+
+// Unpacker knows how to retrieve an operator bundle from some backing store
+// and return it as a SingleOperatorManifest ready to be passed to
+// catalogsourceconfig.Manifest.Create().
+type Unpacker interface {
+	// Unpack retrieves the bundle and returns it as a SingleOperatorManifest.
+	Unpack() (*datastore.SingleOperatorManifest, error)
+}
@@ -0,0 +1,48 @@
+package catalogsourceconfig_test
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operator-framework/operator-marketplace/pkg/catalogsourceconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateBundleImageManifest tests that NewBundleImageManifest lays out
+// each bundle directory so it can be built directly into a registry+v1
+// bundle image.
+func TestCreateBundleImageManifest(t *testing.T) {
+	setupDatastore(t)
+
+	expectedPackage := "etcd"
+	sm, err := ds.ReadSingle(expectedPackage)
+	require.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifest := catalogsourceconfig.NewBundleImageManifest(sm, tempDir)
+	err = manifest.Create()
+	assert.NoError(t, err)
+	manifestDir := filepath.Join(tempDir, expectedPackage)
+
+	bundleDir := filepath.Join(manifestDir, "0.9.2")
+	assert.DirExists(t, filepath.Join(bundleDir, "manifests"))
+	assert.DirExists(t, filepath.Join(bundleDir, "metadata"))
+	assert.FileExists(t, filepath.Join(bundleDir, "metadata", "annotations.yaml"))
+	assert.FileExists(t, filepath.Join(bundleDir, "Dockerfile"))
+	assert.FileExists(t, filepath.Join(bundleDir, "manifests", "etcdclusters.etcd.database.coreos.com.crd.yaml"))
+
+	err = manifest.Delete()
+	assert.NoError(t, err)
+	_, err = os.Stat(manifestDir)
+	assert.True(t, os.IsNotExist(err))
+
+	os.RemoveAll(tempDir)
+}
@@ -0,0 +1,331 @@
+package catalogsourceconfig
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+)
+
+// Declarative config schema values as per
+// https://github.com/operator-framework/operator-registry/blob/master/docs/design/olm-1.0/kubectl-operator/file-based-catalogs.md
+const (
+	schemaPackage = "olm.package"
+	schemaChannel = "olm.channel"
+	schemaBundle  = "olm.bundle"
+
+	propertyTypePackage      = "olm.package"
+	propertyTypeGVK          = "olm.gvk"
+	propertyTypeBundleObject = "olm.bundle.object"
+)
+
+// declarativeConfigPackage is the olm.package blob for a single package.
+type declarativeConfigPackage struct {
+	Schema         string `json:"schema"`
+	Name           string `json:"name"`
+	DefaultChannel string `json:"defaultChannel"`
+	Icon           *icon  `json:"icon,omitempty"`
+	Description    string `json:"description,omitempty"`
+}
+
+type icon struct {
+	Base64Data string `json:"base64data"`
+	MediaType  string `json:"mediatype"`
+}
+
+// declarativeConfigChannel is the olm.channel blob for a single channel in a
+// package.
+type declarativeConfigChannel struct {
+	Schema  string                          `json:"schema"`
+	Name    string                          `json:"name"`
+	Package string                          `json:"package"`
+	Entries []declarativeConfigChannelEntry `json:"entries"`
+}
+
+// declarativeConfigChannelEntry is a single node in a channel's upgrade graph.
+type declarativeConfigChannelEntry struct {
+	Name      string   `json:"name"`
+	Replaces  string   `json:"replaces,omitempty"`
+	Skips     []string `json:"skips,omitempty"`
+	SkipRange string   `json:"skipRange,omitempty"`
+}
+
+// declarativeConfigBundle is the olm.bundle blob for a single CSV version.
+type declarativeConfigBundle struct {
+	Schema     string                      `json:"schema"`
+	Name       string                      `json:"name"`
+	Package    string                      `json:"package"`
+	Image      string                      `json:"image,omitempty"`
+	Properties []declarativeConfigProperty `json:"properties,omitempty"`
+}
+
+// declarativeConfigProperty is a single olm property attached to a bundle.
+type declarativeConfigProperty struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// fbcManifest renders a SingleOperatorManifest as a file-based catalog, per
+// https://olm.operatorframework.io/docs/reference/file-based-catalogs/.
+// Unlike manifest, it writes a single catalog.yaml per package rather than a
+// package YAML plus one directory per bundle version.
+type fbcManifest struct {
+	singleManifest *datastore.SingleOperatorManifest
+	registryDir    string
+	manifestDir    string
+}
+
+// NewFBCManifest returns a new instance of a Manifest that renders its output
+// as a file-based catalog (olm.package/olm.channel/olm.bundle) instead of the
+// legacy operator-registry manifest format produced by NewManifest.
+func NewFBCManifest(singleManifest *datastore.SingleOperatorManifest, registryDir string) Manifest {
+	return &fbcManifest{
+		singleManifest: singleManifest,
+		registryDir:    registryDir,
+	}
+}
+
+func (b *fbcManifest) Create() (err error) {
+	err = b.createManifestDir()
+	if err != nil {
+		return
+	}
+
+	blobs, err := b.buildBlobs()
+	if err != nil {
+		return
+	}
+
+	return b.writeCatalogYAML(blobs)
+}
+
+// createManifestDir creates the package directory. Example: registryDir/etcd
+func (b *fbcManifest) createManifestDir() error {
+	b.manifestDir = filepath.Join(b.registryDir, b.singleManifest.GetPackageID())
+	return createDir(b.manifestDir)
+}
+
+// buildBlobs builds the olm.package, olm.channel and olm.bundle blobs that
+// make up the declarative config for this package.
+func (b *fbcManifest) buildBlobs() ([]interface{}, error) {
+	pkg := b.singleManifest.Package
+
+	blobs := []interface{}{
+		declarativeConfigPackage{
+			Schema:         schemaPackage,
+			Name:           pkg.PackageName,
+			DefaultChannel: pkg.DefaultChannelName,
+		},
+	}
+
+	crdMap := datastore.CustomResourceDefinitionMap{}
+	for _, crd := range b.singleManifest.CustomResourceDefinitions {
+		crdMap[crd.Key()] = crd
+	}
+
+	csvsByName := map[string]*datastore.ClusterServiceVersion{}
+	for _, csv := range b.singleManifest.ClusterServiceVersions {
+		csvsByName[csv.GetName()] = csv
+	}
+
+	for _, channel := range pkg.Channels {
+		entries, err := b.buildChannelEntries(channel, csvsByName)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, declarativeConfigChannel{
+			Schema:  schemaChannel,
+			Name:    channel.Name,
+			Package: pkg.PackageName,
+			Entries: entries,
+		})
+	}
+
+	for _, csv := range b.singleManifest.ClusterServiceVersions {
+		bundle, err := b.buildBundle(csv, crdMap)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, bundle)
+	}
+
+	return blobs, nil
+}
+
+// buildChannelEntries walks the CSVs reachable from a channel's head via
+// GetReplaces() to build the channel's upgrade graph.
+func (b *fbcManifest) buildChannelEntries(channel datastore.PackageChannel, csvsByName map[string]*datastore.ClusterServiceVersion) ([]declarativeConfigChannelEntry, error) {
+	var entries []declarativeConfigChannelEntry
+
+	visited := map[string]bool{}
+	name := channel.CurrentCSVName
+	for name != "" && !visited[name] {
+		visited[name] = true
+
+		csv, found := csvsByName[name]
+		if !found {
+			return nil, fmt.Errorf("CSV %s referenced by channel %s not found", name, channel.Name)
+		}
+
+		replaces, err := csv.GetReplaces()
+		if err != nil {
+			return nil, err
+		}
+
+		skips, err := csv.GetSkips()
+		if err != nil {
+			return nil, err
+		}
+
+		skipRange, err := csv.GetSkipRange()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, declarativeConfigChannelEntry{
+			Name:      name,
+			Replaces:  replaces,
+			Skips:     skips,
+			SkipRange: skipRange,
+		})
+
+		name = replaces
+	}
+
+	return entries, nil
+}
+
+// buildBundle builds the olm.bundle blob for a single CSV, with properties
+// for the package version, each owned CRD's GVK, and the base64-encoded CSV
+// and owned CRD objects.
+func (b *fbcManifest) buildBundle(csv *datastore.ClusterServiceVersion, crdMap datastore.CustomResourceDefinitionMap) (declarativeConfigBundle, error) {
+	version, err := csv.GetVersion()
+	if err != nil {
+		return declarativeConfigBundle{}, err
+	}
+
+	properties, err := b.buildPackageProperty(version)
+	if err != nil {
+		return declarativeConfigBundle{}, err
+	}
+
+	csvObjectProperty, err := b.buildBundleObjectProperty(csv)
+	if err != nil {
+		return declarativeConfigBundle{}, err
+	}
+	properties = append(properties, csvObjectProperty)
+
+	ownedCRDKeys, _, err := csv.GetCustomResourceDefintions()
+	if err != nil {
+		return declarativeConfigBundle{}, err
+	}
+
+	for _, ownedCRDKey := range ownedCRDKeys {
+		crd, found := crdMap[*ownedCRDKey]
+		if !found {
+			return declarativeConfigBundle{}, fmt.Errorf("Owned CRD %s for CSV %s not found", ownedCRDKey, csv.GetName())
+		}
+
+		gvkProperty, err := b.buildGVKProperty(crd)
+		if err != nil {
+			return declarativeConfigBundle{}, err
+		}
+		properties = append(properties, gvkProperty)
+
+		crdObjectProperty, err := b.buildBundleObjectProperty(crd)
+		if err != nil {
+			return declarativeConfigBundle{}, err
+		}
+		properties = append(properties, crdObjectProperty)
+	}
+
+	return declarativeConfigBundle{
+		Schema:     schemaBundle,
+		Name:       csv.GetName(),
+		Package:    b.singleManifest.GetPackageID(),
+		Properties: properties,
+	}, nil
+}
+
+func (b *fbcManifest) buildPackageProperty(version string) ([]declarativeConfigProperty, error) {
+	raw, err := json.Marshal(struct {
+		PackageName string `json:"packageName"`
+		Version     string `json:"version"`
+	}{
+		PackageName: b.singleManifest.GetPackageID(),
+		Version:     version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []declarativeConfigProperty{{Type: propertyTypePackage, Value: raw}}, nil
+}
+
+func (b *fbcManifest) buildGVKProperty(crd *datastore.CustomResourceDefinition) (declarativeConfigProperty, error) {
+	raw, err := json.Marshal(struct {
+		Group   string `json:"group"`
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+	}{
+		Group:   crd.Key().Group,
+		Kind:    crd.Key().Kind,
+		Version: crd.Key().Version,
+	})
+	if err != nil {
+		return declarativeConfigProperty{}, err
+	}
+	return declarativeConfigProperty{Type: propertyTypeGVK, Value: raw}, nil
+}
+
+// buildBundleObjectProperty base64-encodes the YAML form of obj for inclusion
+// as an olm.bundle.object property.
+func (b *fbcManifest) buildBundleObjectProperty(obj interface{}) (declarativeConfigProperty, error) {
+	rawYAML, err := yaml.Marshal(obj)
+	if err != nil {
+		return declarativeConfigProperty{}, fmt.Errorf("Error %s marshaling %s into YAML", obj, err)
+	}
+
+	raw, err := json.Marshal(struct {
+		Data string `json:"data"`
+	}{
+		Data: base64.StdEncoding.EncodeToString(rawYAML),
+	})
+	if err != nil {
+		return declarativeConfigProperty{}, err
+	}
+	return declarativeConfigProperty{Type: propertyTypeBundleObject, Value: raw}, nil
+}
+
+// writeCatalogYAML writes the given blobs as a "---" separated YAML stream to
+// registryDir/<package>/catalog.yaml.
+func (b *fbcManifest) writeCatalogYAML(blobs []interface{}) error {
+	var raw []byte
+	for i, blob := range blobs {
+		if i > 0 {
+			raw = append(raw, []byte("---\n")...)
+		}
+		blobYAML, err := yaml.Marshal(blob)
+		if err != nil {
+			return fmt.Errorf("Error %s marshaling %s into YAML", blob, err)
+		}
+		raw = append(raw, blobYAML...)
+	}
+
+	file := filepath.Join(b.manifestDir, "catalog.yaml")
+	if err := ioutil.WriteFile(file, raw, 0666); err != nil {
+		return fmt.Errorf("Error %s creating %s file", err, file)
+	}
+	return nil
+}
+
+func (b *fbcManifest) Delete() error {
+	if b.manifestDir == "" {
+		return nil
+	}
+	return os.RemoveAll(b.manifestDir)
+}
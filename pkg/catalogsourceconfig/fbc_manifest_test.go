@@ -0,0 +1,111 @@
+package catalogsourceconfig_test
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/operator-framework/operator-marketplace/pkg/catalogsourceconfig"
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateFBCManifest tests that the file-based catalog emitted for a
+// package parses back into the expected olm.package/olm.channel/olm.bundle
+// blob graph.
+func TestCreateFBCManifest(t *testing.T) {
+	setupDatastore(t)
+
+	expectedPackage := "etcd"
+	sm, err := ds.ReadSingle(expectedPackage)
+	require.NoError(t, err)
+
+	tempDir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifest := catalogsourceconfig.NewFBCManifest(sm, tempDir)
+	err = manifest.Create()
+	assert.NoError(t, err)
+	manifestDir := filepath.Join(tempDir, expectedPackage)
+
+	// Check if /tmp/registryNNN/etcd/ was created
+	assert.DirExists(t, manifestDir)
+
+	// Check if /tmp/registryNNN/etcd/catalog.yaml was created
+	filename := filepath.Join(manifestDir, "catalog.yaml")
+	assert.FileExists(t, filename)
+
+	blobs := readCatalogBlobs(t, filename)
+
+	var sawPackage bool
+	var bundleNames []string
+	for _, blob := range blobs {
+		switch blob["schema"] {
+		case "olm.package":
+			sawPackage = true
+			assert.Equal(t, expectedPackage, blob["name"])
+		case "olm.bundle":
+			bundleNames = append(bundleNames, blob["name"].(string))
+		}
+	}
+	assert.True(t, sawPackage, "expected an olm.package blob")
+
+	expectedBundleVersions := []string{"0.6.1", "0.9.0", "0.9.2"}
+	for _, version := range expectedBundleVersions {
+		var found bool
+		for _, bundleName := range bundleNames {
+			if strings.Contains(bundleName, version) {
+				found = true
+				break
+			}
+		}
+		assert.True(t, found, "expected a bundle whose name contains version %s, got bundles %v", version, bundleNames)
+	}
+
+	err = manifest.Delete()
+	assert.NoError(t, err)
+	_, err = os.Stat(manifestDir)
+	assert.True(t, os.IsNotExist(err))
+
+	os.RemoveAll(tempDir)
+}
+
+// readCatalogBlobs parses a "---" separated YAML stream into a slice of
+// generic maps, one per document.
+func readCatalogBlobs(t *testing.T, filename string) []map[string]interface{} {
+	raw, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+
+	var blobs []map[string]interface{}
+	for _, doc := range splitYAMLDocs(raw) {
+		if len(doc) == 0 {
+			continue
+		}
+		blob := map[string]interface{}{}
+		err := yaml.Unmarshal(doc, &blob)
+		require.NoError(t, err)
+		blobs = append(blobs, blob)
+	}
+	return blobs
+}
+
+func splitYAMLDocs(raw []byte) [][]byte {
+	var docs [][]byte
+	start := 0
+	sep := []byte("---\n")
+	for i := 0; i+len(sep) <= len(raw); i++ {
+		if string(raw[i:i+len(sep)]) == string(sep) {
+			docs = append(docs, raw[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	docs = append(docs, raw[start:])
+	return docs
+}
@@ -0,0 +1,32 @@
+package catalogsourceconfig
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Finalizer is set on every CatalogSourceConfig by the controller on
+// admission, and is only cleared once the on-disk manifest directory, the
+// generated ConfigMap in spec.targetNamespace, and the child CatalogSource
+// have all been deleted. This prevents those artifacts from leaking when the
+// CatalogSourceConfig is deleted before the controller can run its normal
+// Delete() path, e.g. on abnormal deletion or while the controller itself is
+// restarting.
+const Finalizer = "marketplace.redhat.com/csc-cleanup"
+
+// ManifestDirForPackageID returns the manifest directory for packageID under
+// registryDir, i.e. the same path createManifestDir would have recorded on
+// manifest.manifestDir. The controller uses this to recompute the manifest
+// directory to clean up when it restarts before having reconciled the
+// CatalogSourceConfig once, and so never had a live manifest value to call
+// Delete() on.
+func ManifestDirForPackageID(registryDir, packageID string) string {
+	return filepath.Join(registryDir, packageID)
+}
+
+// CleanupManifestDir removes the manifest directory for packageID under
+// registryDir, if present. It is safe to call even if the directory was
+// never created.
+func CleanupManifestDir(registryDir, packageID string) error {
+	return os.RemoveAll(ManifestDirForPackageID(registryDir, packageID))
+}
@@ -0,0 +1,38 @@
+package catalogsourceconfig
+
+import (
+	"fmt"
+
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+)
+
+// Format identifies the on-disk layout that a Manifest should be rendered in.
+type Format string
+
+const (
+	// RegistryV1Format is the legacy operator-registry manifest format: one
+	// directory per package, a "*.package.yaml" at the top, and one
+	// subdirectory per CSV version containing the CSV and owned CRD YAMLs.
+	RegistryV1Format Format = "registry+v1"
+
+	// FBCFormat is the declarative config (file-based catalog) format
+	// consumed by opm and catalogd: a single catalog.yaml per package.
+	FBCFormat Format = "fbc"
+)
+
+// NewManifestForFormat returns the Manifest implementation appropriate for
+// the given Format. It defaults to the legacy registry+v1 format when format
+// is empty, so that CatalogSourceConfigs created before the format field was
+// introduced keep their existing on-disk layout. opts.Mode only applies to
+// the registry+v1 format; the FBC format does not yet support best-effort
+// CSV skipping, so opts is ignored when format is FBCFormat.
+func NewManifestForFormat(format Format, singleManifest *datastore.SingleOperatorManifest, registryDir string, opts CreateOptions) (Manifest, error) {
+	switch format {
+	case "", RegistryV1Format:
+		return NewManifestWithOptions(singleManifest, registryDir, opts), nil
+	case FBCFormat:
+		return NewFBCManifest(singleManifest, registryDir), nil
+	default:
+		return nil, fmt.Errorf("Unknown manifest format %q", format)
+	}
+}
@@ -2,19 +2,83 @@ package catalogsourceconfig
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/operator-framework/operator-marketplace/pkg/datastore"
 )
 
+// Mode controls how createBundles reacts to an invalid CSV.
+type Mode int
+
+const (
+	// StrictFailFast stops at the first invalid CSV and returns its error,
+	// leaving no bundles published. This is the default.
+	StrictFailFast Mode = iota
+
+	// BestEffortSkipInvalid skips invalid CSVs, logging them to
+	// CreateOptions.Logger, and still publishes the bundles for the CSVs
+	// that were valid.
+	BestEffortSkipInvalid
+)
+
+// CreateOptions configures how Create() handles an invalid CSV.
+type CreateOptions struct {
+	// Mode selects strict fail-fast or best-effort behavior. The zero value
+	// is StrictFailFast.
+	Mode Mode
+
+	// Logger receives one line per skipped CSV when Mode is
+	// BestEffortSkipInvalid. If nil, skips are not logged.
+	Logger io.Writer
+}
+
+// BundleOutcome records whether a single CSV's bundle was created or skipped.
+type BundleOutcome struct {
+	// CSVName is the name of the CSV this outcome is for.
+	CSVName string
+
+	// Skipped is true if the CSV was invalid and Mode was
+	// BestEffortSkipInvalid, so its bundle was not published.
+	Skipped bool
+
+	// Error is the error encountered while creating the bundle for this CSV,
+	// if any.
+	Error error
+}
+
+// ManifestResult reports the per-CSV outcome of a Create() call.
+type ManifestResult struct {
+	Bundles []BundleOutcome
+}
+
+// ManifestResulter is implemented by Manifest instances that can report a
+// structured ManifestResult after Create() returns.
+type ManifestResulter interface {
+	// Result returns the outcome of the most recent Create() call, or nil if
+	// Create() has not been called yet.
+	Result() *ManifestResult
+}
+
 type manifest struct {
 	singleManifest *datastore.SingleOperatorManifest
 	registryDir    string
 	manifestDir    string
 	versionDir     string
+
+	// bundleImage, when set, additionally lays out each bundle directory as
+	// a buildable registry+v1 bundle image: a manifests/metadata split plus
+	// an annotations.yaml and Dockerfile, per
+	// https://github.com/operator-framework/operator-registry#building-a-bundle-image.
+	bundleImage bool
+
+	mode   Mode
+	logger io.Writer
+	result *ManifestResult
 }
 
 // Manifest is the interface for creating an operator-registry manifest for an
@@ -24,10 +88,13 @@ type Manifest interface {
 	// Create() is the entrypoint to generate the operator files on disk as per
 	// https://github.com/operator-framework/operator-registry#manifest-format.
 	// It is up to the caller to call Delete() on any error or to clean up.
-	// The function returns on the first encountered error and does not attempt
-	// to create a partially valid manifest. For example: if CSV v1 is valid but
-	// CSV v2 is invalid, it will return an error and the caller is required to
-	// call Delete().
+	// Under the default StrictFailFast mode, the function returns on the
+	// first encountered error and does not attempt to create a partially
+	// valid manifest. For example: if CSV v1 is valid but CSV v2 is invalid,
+	// it will return an error and the caller is required to call Delete().
+	// A Manifest created with NewManifestWithOptions and
+	// BestEffortSkipInvalid instead skips invalid CSVs and publishes the
+	// rest; see ManifestResulter for how to find out which were skipped.
 	Create() error
 
 	// Delete() is used to delete the manifest directories and files on error or
@@ -43,6 +110,39 @@ func NewManifest(singleManifest *datastore.SingleOperatorManifest, registryDir s
 	}
 }
 
+// NewBundleImageManifest returns a new instance of manifest that, in
+// addition to the usual operator-registry manifest layout, lays out each
+// bundle directory so it can be "docker build"-ed directly into a
+// registry+v1 bundle image: manifests/ and metadata/ subdirectories, an
+// annotations.yaml, and a Dockerfile.
+func NewBundleImageManifest(singleManifest *datastore.SingleOperatorManifest, registryDir string) Manifest {
+	return &manifest{
+		singleManifest: singleManifest,
+		registryDir:    registryDir,
+		bundleImage:    true,
+	}
+}
+
+// NewManifestWithOptions returns a new instance of manifest that creates its
+// bundles according to opts.Mode instead of always stopping at the first
+// invalid CSV. The returned Manifest also implements ManifestResulter, so
+// callers that opted into BestEffortSkipInvalid can inspect which CSVs were
+// skipped and why.
+func NewManifestWithOptions(singleManifest *datastore.SingleOperatorManifest, registryDir string, opts CreateOptions) Manifest {
+	return &manifest{
+		singleManifest: singleManifest,
+		registryDir:    registryDir,
+		mode:           opts.Mode,
+		logger:         opts.Logger,
+	}
+}
+
+// Result returns the outcome of the most recent Create() call, or nil if
+// Create() has not been called yet.
+func (b *manifest) Result() *ManifestResult {
+	return b.result
+}
+
 func (b *manifest) Create() (err error) {
 	err = b.createManifestDir()
 	if err != nil {
@@ -62,17 +162,42 @@ func (b *manifest) Create() (err error) {
 	return
 }
 
-// createBundle creates the bundle for the CSV
+// createBundle creates the bundle for the CSV. When b.bundleImage is set, the
+// CSV and CRD YAMLs are written under a manifests/ subdirectory and a
+// metadata/annotations.yaml and Dockerfile are added alongside it, so the
+// bundle directory can be built directly into a registry+v1 bundle image.
 func (b *manifest) createBundle(csv *datastore.ClusterServiceVersion) (err error) {
 	bundleDir, err := b.createBundleDir(csv)
 	if err != nil {
 		return
 	}
-	err = b.createCRDYAMLs(csv, bundleDir)
+
+	manifestsDir := bundleDir
+	if b.bundleImage {
+		manifestsDir = filepath.Join(bundleDir, "manifests")
+		if err = createDir(manifestsDir); err != nil {
+			return
+		}
+	}
+
+	err = b.createCRDYAMLs(csv, manifestsDir)
+	if err != nil {
+		return
+	}
+	err = b.createCSVYAML(csv, manifestsDir)
+	if err != nil {
+		return
+	}
+
+	if !b.bundleImage {
+		return
+	}
+
+	err = b.createAnnotationsYAML(csv, bundleDir)
 	if err != nil {
 		return
 	}
-	err = b.createCSVYAML(csv, bundleDir)
+	err = b.createDockerfile(csv, bundleDir)
 	if err != nil {
 		return
 	}
@@ -93,12 +218,44 @@ func (b *manifest) createBundleDir(csv *datastore.ClusterServiceVersion) (string
 	return bundleDir, createDir(bundleDir)
 }
 
-// createBundles creates bundles for each CSV
-func (b *manifest) createBundles() (err error) {
+// createBundles creates bundles for each CSV. In StrictFailFast mode (the
+// default) it returns on the first invalid CSV and does not attempt to
+// create a partially valid manifest. In BestEffortSkipInvalid mode it skips
+// invalid CSVs, logs them, and keeps going so the valid bundles still get
+// published.
+func (b *manifest) createBundles() error {
+	b.result = &ManifestResult{}
+
 	for _, csv := range b.singleManifest.ClusterServiceVersions {
-		b.createBundle(csv)
+		err := b.createBundle(csv)
+		if err == nil {
+			b.result.Bundles = append(b.result.Bundles, BundleOutcome{CSVName: csv.GetName()})
+			continue
+		}
+
+		if b.mode != BestEffortSkipInvalid {
+			return err
+		}
+
+		b.logf("skipping CSV %s: %s", csv.GetName(), err)
+		b.result.Bundles = append(b.result.Bundles, BundleOutcome{
+			CSVName: csv.GetName(),
+			Skipped: true,
+			Error:   err,
+		})
+		if version, verErr := csv.GetVersion(); verErr == nil && version != "" {
+			os.RemoveAll(filepath.Join(b.manifestDir, version))
+		}
 	}
-	return
+	return nil
+}
+
+// logf writes a formatted line to b.logger, if one was configured.
+func (b *manifest) logf(format string, args ...interface{}) {
+	if b.logger == nil {
+		return
+	}
+	fmt.Fprintf(b.logger, format+"\n", args...)
 }
 
 // createCRDYAML creates the CRD YAML in the bundle directory
@@ -137,6 +294,100 @@ func (b *manifest) createCSVYAML(csv *datastore.ClusterServiceVersion, bundleDir
 	return createYAML(csv, filepath.Join(bundleDir, csv.GetName()+".csv.yaml"))
 }
 
+// bundleAnnotations is the metadata/annotations.yaml written for a
+// registry+v1 bundle image, per
+// https://github.com/operator-framework/operator-registry#operator-bundle-overview.
+type bundleAnnotations struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+const (
+	annotationMediaType      = "operators.operatorframework.io.bundle.mediatype.v1"
+	annotationPackage        = "operators.operatorframework.io.bundle.package.v1"
+	annotationChannels       = "operators.operatorframework.io.bundle.channels.v1"
+	annotationDefaultChannel = "operators.operatorframework.io.bundle.channel.default.v1"
+
+	registryV1MediaType = "registry+v1"
+)
+
+// createAnnotationsYAML creates metadata/annotations.yaml describing which
+// channels the CSV participates in.
+func (b *manifest) createAnnotationsYAML(csv *datastore.ClusterServiceVersion, bundleDir string) error {
+	metadataDir := filepath.Join(bundleDir, "metadata")
+	if err := createDir(metadataDir); err != nil {
+		return err
+	}
+
+	annotations := bundleAnnotations{
+		Annotations: map[string]string{
+			annotationMediaType:      registryV1MediaType,
+			annotationPackage:        b.singleManifest.GetPackageID(),
+			annotationChannels:       strings.Join(b.channelsFor(csv), ","),
+			annotationDefaultChannel: b.singleManifest.Package.DefaultChannelName,
+		},
+	}
+	return createYAML(annotations, filepath.Join(metadataDir, "annotations.yaml"))
+}
+
+// createDockerfile creates a Dockerfile that builds bundleDir into a
+// registry+v1 bundle image, with LABELs mirroring metadata/annotations.yaml.
+func (b *manifest) createDockerfile(csv *datastore.ClusterServiceVersion, bundleDir string) error {
+	dockerfile := fmt.Sprintf(`FROM scratch
+
+LABEL %s=%s
+LABEL %s=%s
+LABEL %s=%s
+LABEL %s=%s
+
+COPY manifests /manifests/
+COPY metadata /metadata/
+`,
+		annotationMediaType, registryV1MediaType,
+		annotationPackage, b.singleManifest.GetPackageID(),
+		annotationChannels, strings.Join(b.channelsFor(csv), ","),
+		annotationDefaultChannel, b.singleManifest.Package.DefaultChannelName,
+	)
+
+	file := filepath.Join(bundleDir, "Dockerfile")
+	if err := ioutil.WriteFile(file, []byte(dockerfile), 0666); err != nil {
+		return fmt.Errorf("Error %s creating %s file", err, file)
+	}
+	return nil
+}
+
+// channelsFor returns the names of the channels that csv participates in, by
+// walking each channel's upgrade graph from its head via GetReplaces().
+func (b *manifest) channelsFor(csv *datastore.ClusterServiceVersion) []string {
+	var channels []string
+	for _, channel := range b.singleManifest.Package.Channels {
+		name := channel.CurrentCSVName
+		visited := map[string]bool{}
+		for name != "" && !visited[name] {
+			if name == csv.GetName() {
+				channels = append(channels, channel.Name)
+				break
+			}
+			visited[name] = true
+			replaces, err := b.csvReplaces(name)
+			if err != nil {
+				break
+			}
+			name = replaces
+		}
+	}
+	return channels
+}
+
+// csvReplaces returns the value of GetReplaces() for the CSV named name.
+func (b *manifest) csvReplaces(name string) (string, error) {
+	for _, csv := range b.singleManifest.ClusterServiceVersions {
+		if csv.GetName() == name {
+			return csv.GetReplaces()
+		}
+	}
+	return "", fmt.Errorf("CSV %s not found", name)
+}
+
 // createManifestDir creates the package directory. Example: registryDir/etcd
 func (b *manifest) createManifestDir() error {
 	b.manifestDir = filepath.Join(b.registryDir, b.singleManifest.GetPackageID())
@@ -158,9 +409,16 @@ func (b *manifest) Delete() error {
 	return os.RemoveAll(b.manifestDir)
 }
 
+// createDir (re)creates dir from scratch, so that reconciling the same
+// CatalogSourceConfig more than once -- which controller-runtime does on
+// every resync, not just once -- doesn't fail with "file exists", and so
+// that a manifest regenerated with a different set of bundles doesn't keep
+// stale files around from the previous one.
 func createDir(dir string) error {
-	err := os.Mkdir(dir, 0700)
-	if err != nil {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("Error %s removing existing %s directory", err, dir)
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
 		return fmt.Errorf("Error %s creating %s directory", err, dir)
 	}
 	return nil
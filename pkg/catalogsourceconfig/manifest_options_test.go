@@ -0,0 +1,150 @@
+package catalogsourceconfig_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/operator-framework/operator-marketplace/pkg/catalogsourceconfig"
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateManifestWithOptionsReportsResult checks that Create() populates a
+// ManifestResult listing every CSV as published when all of them are valid,
+// under both StrictFailFast (the default) and BestEffortSkipInvalid.
+func TestCreateManifestWithOptionsReportsResult(t *testing.T) {
+	setupDatastore(t)
+
+	sm, err := ds.ReadSingle("etcd")
+	require.NoError(t, err)
+
+	for _, mode := range []catalogsourceconfig.Mode{catalogsourceconfig.StrictFailFast, catalogsourceconfig.BestEffortSkipInvalid} {
+		tempDir, err := ioutil.TempDir("", "registry")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var logBuf bytes.Buffer
+		manifest := catalogsourceconfig.NewManifestWithOptions(sm, tempDir, catalogsourceconfig.CreateOptions{
+			Mode:   mode,
+			Logger: &logBuf,
+		})
+		err = manifest.Create()
+		assert.NoError(t, err)
+
+		resulter, ok := manifest.(catalogsourceconfig.ManifestResulter)
+		require.True(t, ok, "NewManifestWithOptions should return a ManifestResulter")
+
+		result := resulter.Result()
+		require.NotNil(t, result)
+		assert.Len(t, result.Bundles, len(sm.ClusterServiceVersions))
+		for _, bundle := range result.Bundles {
+			assert.False(t, bundle.Skipped)
+			assert.NoError(t, bundle.Error)
+		}
+		assert.Empty(t, logBuf.String(), "nothing should have been logged when every CSV is valid")
+
+		assert.NoError(t, manifest.Delete())
+		os.RemoveAll(tempDir)
+	}
+}
+
+// invalidSingleOperatorManifest returns a copy of sm with its "etcdbackups"
+// CRD removed, so that every CSV owning it (0.9.0 and 0.9.2) fails to build
+// its bundle while the CSV that does not own it (0.6.1) still succeeds.
+func invalidSingleOperatorManifest(sm *datastore.SingleOperatorManifest) *datastore.SingleOperatorManifest {
+	var crds []*datastore.CustomResourceDefinition
+	for _, crd := range sm.CustomResourceDefinitions {
+		if strings.HasPrefix(crd.GetName(), "etcdbackups") {
+			continue
+		}
+		crds = append(crds, crd)
+	}
+
+	return &datastore.SingleOperatorManifest{
+		Package:                   sm.Package,
+		ClusterServiceVersions:    sm.ClusterServiceVersions,
+		CustomResourceDefinitions: crds,
+	}
+}
+
+// TestCreateManifestStrictFailFastStopsAtFirstInvalidCSV checks that, under
+// the default StrictFailFast mode, Create() returns the first bundle error
+// it hits instead of silently producing a partial package directory.
+func TestCreateManifestStrictFailFastStopsAtFirstInvalidCSV(t *testing.T) {
+	setupDatastore(t)
+
+	sm, err := ds.ReadSingle("etcd")
+	require.NoError(t, err)
+	invalidSM := invalidSingleOperatorManifest(sm)
+
+	tempDir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manifest := catalogsourceconfig.NewManifest(invalidSM, tempDir)
+	err = manifest.Create()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "etcdbackups")
+
+	assert.NoError(t, manifest.Delete())
+}
+
+// TestCreateManifestBestEffortSkipsInvalidCSVs checks that, under
+// BestEffortSkipInvalid, Create() logs and skips the CSVs whose bundles
+// fail to build while still publishing the CSVs that succeed, and reports
+// all of this in the ManifestResult.
+func TestCreateManifestBestEffortSkipsInvalidCSVs(t *testing.T) {
+	setupDatastore(t)
+
+	sm, err := ds.ReadSingle("etcd")
+	require.NoError(t, err)
+	invalidSM := invalidSingleOperatorManifest(sm)
+
+	tempDir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var logBuf bytes.Buffer
+	manifest := catalogsourceconfig.NewManifestWithOptions(invalidSM, tempDir, catalogsourceconfig.CreateOptions{
+		Mode:   catalogsourceconfig.BestEffortSkipInvalid,
+		Logger: &logBuf,
+	})
+	err = manifest.Create()
+	assert.NoError(t, err)
+
+	resulter, ok := manifest.(catalogsourceconfig.ManifestResulter)
+	require.True(t, ok, "NewManifestWithOptions should return a ManifestResulter")
+
+	result := resulter.Result()
+	require.NotNil(t, result)
+	assert.Len(t, result.Bundles, len(invalidSM.ClusterServiceVersions))
+
+	var skipped, published int
+	for _, bundle := range result.Bundles {
+		if bundle.Skipped {
+			skipped++
+			assert.Error(t, bundle.Error)
+			assert.Contains(t, bundle.Error.Error(), "etcdbackups")
+			continue
+		}
+		published++
+		assert.NoError(t, bundle.Error)
+	}
+	// 0.9.0 and 0.9.2 own etcdbackups and are skipped; 0.6.1 does not and is
+	// published.
+	assert.Equal(t, 2, skipped)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, skipped, strings.Count(logBuf.String(), "skipping CSV"))
+
+	assert.NoError(t, manifest.Delete())
+}
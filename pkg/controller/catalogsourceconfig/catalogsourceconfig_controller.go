@@ -0,0 +1,276 @@
+// Package catalogsourceconfig contains the controller that reconciles
+// CatalogSourceConfig objects by generating their manifest on disk, in the
+// format requested by spec.Format.
+package catalogsourceconfig
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/operator-framework/operator-marketplace/pkg/apis/marketplace/v1alpha1"
+	"github.com/operator-framework/operator-marketplace/pkg/bundle/source"
+	"github.com/operator-framework/operator-marketplace/pkg/catalogsourceconfig"
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// registryDir is where manifests generated from CatalogSourceConfigs are
+// written on the marketplace-operator's local disk before being rolled up
+// into the generated ConfigMap.
+const registryDir = "/tmp/catalogsourceconfigs/registry"
+
+// catalogSourceGVK identifies the child CatalogSource created for a
+// CatalogSourceConfig in spec.targetNamespace. It is read and deleted
+// through an unstructured client rather than a typed OLM API import, since
+// this operator does not otherwise depend on the OLM API types.
+var catalogSourceGVK = schema.GroupVersionKind{
+	Group:   "operators.coreos.com",
+	Version: "v1alpha1",
+	Kind:    "CatalogSource",
+}
+
+// Reconciler reconciles a CatalogSourceConfig object.
+type Reconciler struct {
+	client    client.Client
+	datastore datastore.Reader
+}
+
+// NewReconciler returns a new Reconciler for CatalogSourceConfig objects.
+func NewReconciler(client client.Client, reader datastore.Reader) *Reconciler {
+	return &Reconciler{
+		client:    client,
+		datastore: reader,
+	}
+}
+
+// Reconcile generates the on-disk manifest for the package named by
+// request, in the format selected by the CatalogSourceConfig's spec.Format
+// (the legacy operator-registry manifest format by default, or a
+// file-based catalog when Format is "fbc"). The package itself comes from
+// spec.Bundles when set, pulling each bundle image directly from its
+// registry, or otherwise from the datastore populated by the backing
+// OperatorSource's app-registry scrape.
+//
+// Every CatalogSourceConfig has catalogsourceconfig.Finalizer set on
+// admission, and Reconcile only clears it once the manifest directory, the
+// generated ConfigMap, and the child CatalogSource have all been removed.
+// This keeps those artifacts from leaking if the CatalogSourceConfig is
+// deleted while the controller is down, since the finalizer blocks the
+// delete from completing until this Reconcile runs the cleanup.
+func (r *Reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx := context.TODO()
+
+	csc := &v1alpha1.CatalogSourceConfig{}
+	if err := r.client.Get(ctx, request.NamespacedName, csc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if !csc.GetDeletionTimestamp().IsZero() {
+		return reconcile.Result{}, r.finalize(ctx, csc)
+	}
+
+	if !containsString(csc.GetFinalizers(), catalogsourceconfig.Finalizer) {
+		csc.SetFinalizers(append(csc.GetFinalizers(), catalogsourceconfig.Finalizer))
+		if err := r.client.Update(ctx, csc); err != nil {
+			return reconcile.Result{}, fmt.Errorf("Error %s setting finalizer on %s", err, csc.GetName())
+		}
+		return reconcile.Result{}, nil
+	}
+
+	var singleManifest *datastore.SingleOperatorManifest
+	var err error
+	if len(csc.Spec.Bundles) > 0 {
+		singleManifest, err = r.readFromBundleImages(ctx, csc)
+	} else {
+		singleManifest, err = r.datastore.ReadSingle(csc.GetName())
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	opts := catalogsourceconfig.CreateOptions{Mode: toManifestMode(csc.Spec.Mode)}
+	manifest, err := catalogsourceconfig.NewManifestForFormat(
+		catalogsourceconfig.Format(csc.Spec.Format), singleManifest, registryDir, opts)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if err := manifest.Create(); err != nil {
+		return reconcile.Result{}, fmt.Errorf("Error %s creating manifest for %s", err, csc.GetName())
+	}
+
+	if resulter, ok := manifest.(catalogsourceconfig.ManifestResulter); ok {
+		if err := r.updateBundleOutcomes(ctx, csc, resulter.Result()); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// toManifestMode translates the CatalogSourceConfig's spec.mode into the
+// catalogsourceconfig.Mode understood by NewManifestForFormat.
+func toManifestMode(mode v1alpha1.ManifestCreationMode) catalogsourceconfig.Mode {
+	if mode == v1alpha1.BestEffortSkipInvalidMode {
+		return catalogsourceconfig.BestEffortSkipInvalid
+	}
+	return catalogsourceconfig.StrictFailFast
+}
+
+// updateBundleOutcomes records result's per-CSV outcomes on csc's status, if
+// result is non-nil, i.e. once Create() has run on a registry+v1 manifest,
+// under either creation mode.
+func (r *Reconciler) updateBundleOutcomes(ctx context.Context, csc *v1alpha1.CatalogSourceConfig, result *catalogsourceconfig.ManifestResult) error {
+	if result == nil {
+		return nil
+	}
+
+	outcomes := make([]v1alpha1.BundleOutcome, len(result.Bundles))
+	for i, bundle := range result.Bundles {
+		outcome := v1alpha1.BundleOutcome{CSVName: bundle.CSVName, Skipped: bundle.Skipped}
+		if bundle.Error != nil {
+			outcome.Message = bundle.Error.Error()
+		}
+		outcomes[i] = outcome
+	}
+
+	csc.Status.BundleOutcomes = outcomes
+	if err := r.client.Update(ctx, csc); err != nil {
+		return fmt.Errorf("Error %s updating bundle outcomes on %s", err, csc.GetName())
+	}
+	return nil
+}
+
+// finalize runs the cleanup guarded by catalogsourceconfig.Finalizer on a
+// CatalogSourceConfig that is being deleted -- removing its manifest
+// directory, its generated ConfigMap, and its child CatalogSource -- and
+// then clears the finalizer so the delete can complete. The manifest
+// directory is recomputed from csc's name rather than read off a live
+// manifest value, so cleanup also works after a controller restart where
+// Reconcile never ran for this CatalogSourceConfig.
+func (r *Reconciler) finalize(ctx context.Context, csc *v1alpha1.CatalogSourceConfig) error {
+	if !containsString(csc.GetFinalizers(), catalogsourceconfig.Finalizer) {
+		return nil
+	}
+
+	if err := catalogsourceconfig.CleanupManifestDir(registryDir, csc.GetName()); err != nil {
+		return fmt.Errorf("Error %s removing manifest directory for %s", err, csc.GetName())
+	}
+
+	configMap := &corev1.ConfigMap{}
+	configMapName := types.NamespacedName{Namespace: csc.Spec.TargetNamespace, Name: v1alpha1.ConfigMapPrefix + csc.GetName()}
+	if err := r.client.Get(ctx, configMapName, configMap); err == nil {
+		if err := r.client.Delete(ctx, configMap); err != nil {
+			return fmt.Errorf("Error %s deleting ConfigMap %s", err, configMapName)
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Error %s getting ConfigMap %s", err, configMapName)
+	}
+
+	catalogSource := &unstructured.Unstructured{}
+	catalogSource.SetGroupVersionKind(catalogSourceGVK)
+	catalogSourceName := types.NamespacedName{Namespace: csc.Spec.TargetNamespace, Name: csc.GetName()}
+	if err := r.client.Get(ctx, catalogSourceName, catalogSource); err == nil {
+		if err := r.client.Delete(ctx, catalogSource); err != nil {
+			return fmt.Errorf("Error %s deleting CatalogSource %s", err, catalogSourceName)
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Error %s getting CatalogSource %s", err, catalogSourceName)
+	}
+
+	csc.SetFinalizers(removeString(csc.GetFinalizers(), catalogsourceconfig.Finalizer))
+	if err := r.client.Update(ctx, csc); err != nil {
+		return fmt.Errorf("Error %s clearing finalizer on %s", err, csc.GetName())
+	}
+	return nil
+}
+
+// containsString reports whether slice contains s.
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns a copy of slice with every occurrence of s removed.
+func removeString(slice []string, s string) []string {
+	var out []string
+	for _, item := range slice {
+		if item != s {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// readFromBundleImages unpacks every bundle image in csc.Spec.Bundles and
+// merges them into a single SingleOperatorManifest for csc's package.
+func (r *Reconciler) readFromBundleImages(ctx context.Context, csc *v1alpha1.CatalogSourceConfig) (*datastore.SingleOperatorManifest, error) {
+	singleManifest := &datastore.SingleOperatorManifest{
+		Package: datastore.Package{PackageName: csc.GetName()},
+	}
+
+	seenChannels := map[string]bool{}
+	for _, bundleRef := range csc.Spec.Bundles {
+		var opts []source.ImageUnpackerOption
+		if bundleRef.PullSecret != "" {
+			keychain, err := r.readPullSecretKeychain(ctx, csc.GetNamespace(), bundleRef.PullSecret)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, source.WithKeychain(keychain))
+		}
+		if bundleRef.DigestPinned {
+			opts = append(opts, source.WithDigestPinning())
+		}
+
+		unpacked, err := source.NewImageUnpacker(bundleRef.Image, opts...).Unpack()
+		if err != nil {
+			return nil, fmt.Errorf("Error %s unpacking bundle image %s", err, bundleRef.Image)
+		}
+
+		singleManifest.ClusterServiceVersions = append(singleManifest.ClusterServiceVersions, unpacked.ClusterServiceVersions...)
+		singleManifest.CustomResourceDefinitions = append(singleManifest.CustomResourceDefinitions, unpacked.CustomResourceDefinitions...)
+		if singleManifest.Package.DefaultChannelName == "" {
+			singleManifest.Package.DefaultChannelName = unpacked.Package.DefaultChannelName
+		}
+		for _, channel := range unpacked.Package.Channels {
+			if seenChannels[channel.Name] {
+				continue
+			}
+			seenChannels[channel.Name] = true
+			singleManifest.Package.Channels = append(singleManifest.Package.Channels, channel)
+		}
+	}
+
+	return singleManifest, nil
+}
+
+// readPullSecretKeychain reads the named kubernetes.io/dockerconfigjson
+// Secret from namespace and returns an authn.Keychain backed by it.
+func (r *Reconciler) readPullSecretKeychain(ctx context.Context, namespace, name string) (authn.Keychain, error) {
+	secret := &corev1.Secret{}
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, fmt.Errorf("Error %s getting pull secret %s", err, name)
+	}
+
+	data, found := secret.Data[corev1.DockerConfigJsonKey]
+	if !found {
+		return nil, fmt.Errorf("Pull secret %s is missing %s", name, corev1.DockerConfigJsonKey)
+	}
+
+	return source.NewKeychainFromDockerConfigJSON(data)
+}
@@ -0,0 +1,277 @@
+package catalogsourceconfig_test
+
+import (
+	"archive/tar"
+	"bytes"
+	goctx "context"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/operator-framework/operator-marketplace/pkg/apis/marketplace/v1alpha1"
+	pkgcatalogsourceconfig "github.com/operator-framework/operator-marketplace/pkg/catalogsourceconfig"
+	"github.com/operator-framework/operator-marketplace/pkg/datastore"
+	controller "github.com/operator-framework/operator-marketplace/pkg/controller/catalogsourceconfig"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// testRegistryDir mirrors the unexported registryDir const in the
+// controller package, which NewReconciler does not let tests override.
+// Tests that reconcile a CatalogSourceConfig through to manifest.Create()
+// clean up their package directory under it so they don't leak state
+// between runs.
+const testRegistryDir = "/tmp/catalogsourceconfigs/registry"
+
+// TestReconcileDispatchesToFBCFormat checks that a CatalogSourceConfig with
+// spec.Format set to "fbc" reconciles successfully through
+// catalogsourceconfig.NewManifestForFormat instead of the legacy manifest
+// format.
+func TestReconcileDispatchesToFBCFormat(t *testing.T) {
+	defer os.RemoveAll(pkgcatalogsourceconfig.ManifestDirForPackageID(testRegistryDir, "etcd"))
+
+	ds := datastore.New()
+	metadata := []*datastore.OperatorMetadata{helperLoadFromFile(t, "rh-operators.yaml")}
+	_, err := ds.Write(&v1alpha1.OperatorSource{ObjectMeta: metav1.ObjectMeta{UID: types.UID("123456")}}, metadata)
+	require.NoError(t, err)
+
+	csc := &v1alpha1.CatalogSourceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "etcd",
+			Namespace:  "marketplace",
+			Finalizers: []string{pkgcatalogsourceconfig.Finalizer},
+		},
+		Spec: v1alpha1.CatalogSourceConfigSpec{
+			TargetNamespace: "target",
+			Format:          v1alpha1.FBCManifestFormat,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	client := fake.NewFakeClientWithScheme(scheme, csc)
+
+	r := controller.NewReconciler(client, ds)
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "marketplace", Name: "etcd"}})
+	require.NoError(t, err)
+}
+
+// TestReconcileReadsFromBundleImages checks that a CatalogSourceConfig with
+// spec.Bundles set pulls its package from those bundle images instead of the
+// datastore populated by an OperatorSource app-registry scrape.
+func TestReconcileReadsFromBundleImages(t *testing.T) {
+	defer os.RemoveAll(pkgcatalogsourceconfig.ManifestDirForPackageID(testRegistryDir, "etcd-bundles"))
+
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	image := pushTestBundleImage(t, server.URL, map[string]string{
+		"manifests/etcdoperator.v0.9.2.clusterserviceversion.yaml": `
+apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: etcdoperator.v0.9.2
+spec:
+  version: 0.9.2
+`,
+		"metadata/annotations.yaml": `
+annotations:
+  operators.operatorframework.io.bundle.mediatype.v1: registry+v1
+  operators.operatorframework.io.bundle.package.v1: etcd
+  operators.operatorframework.io.bundle.channels.v1: alpha
+  operators.operatorframework.io.bundle.channel.default.v1: alpha
+`,
+	})
+
+	csc := &v1alpha1.CatalogSourceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "etcd-bundles",
+			Namespace:  "marketplace",
+			Finalizers: []string{pkgcatalogsourceconfig.Finalizer},
+		},
+		Spec: v1alpha1.CatalogSourceConfigSpec{
+			TargetNamespace: "target",
+			Bundles:         []v1alpha1.BundleReference{{Image: image}},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	client := fake.NewFakeClientWithScheme(scheme, csc)
+
+	r := controller.NewReconciler(client, datastore.New())
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "marketplace", Name: "etcd-bundles"}})
+	require.NoError(t, err)
+}
+
+// TestReconcileRecordsBestEffortBundleOutcomes checks that a
+// CatalogSourceConfig with spec.Mode set to BestEffortSkipInvalidMode has
+// its status.BundleOutcomes populated from the manifest's ManifestResult
+// after Reconcile.
+func TestReconcileRecordsBestEffortBundleOutcomes(t *testing.T) {
+	defer os.RemoveAll(pkgcatalogsourceconfig.ManifestDirForPackageID(testRegistryDir, "etcd-besteffort"))
+
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	image := pushTestBundleImage(t, server.URL, map[string]string{
+		"manifests/etcdoperator.v0.9.2.clusterserviceversion.yaml": `
+apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: etcdoperator.v0.9.2
+spec:
+  version: 0.9.2
+`,
+		"metadata/annotations.yaml": `
+annotations:
+  operators.operatorframework.io.bundle.mediatype.v1: registry+v1
+  operators.operatorframework.io.bundle.package.v1: etcd
+  operators.operatorframework.io.bundle.channels.v1: alpha
+  operators.operatorframework.io.bundle.channel.default.v1: alpha
+`,
+	})
+
+	csc := &v1alpha1.CatalogSourceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "etcd-besteffort",
+			Namespace:  "marketplace",
+			Finalizers: []string{pkgcatalogsourceconfig.Finalizer},
+		},
+		Spec: v1alpha1.CatalogSourceConfigSpec{
+			TargetNamespace: "target",
+			Bundles:         []v1alpha1.BundleReference{{Image: image}},
+			Mode:            v1alpha1.BestEffortSkipInvalidMode,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	client := fake.NewFakeClientWithScheme(scheme, csc)
+
+	r := controller.NewReconciler(client, datastore.New())
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "marketplace", Name: "etcd-besteffort"}})
+	require.NoError(t, err)
+
+	updated := &v1alpha1.CatalogSourceConfig{}
+	require.NoError(t, client.Get(goctx.TODO(), types.NamespacedName{Namespace: "marketplace", Name: "etcd-besteffort"}, updated))
+	require.Len(t, updated.Status.BundleOutcomes, 1)
+	require.Equal(t, "etcdoperator.v0.9.2", updated.Status.BundleOutcomes[0].CSVName)
+	require.False(t, updated.Status.BundleOutcomes[0].Skipped)
+}
+
+// TestReconcileSetsFinalizerOnAdmission checks that a freshly created
+// CatalogSourceConfig without catalogsourceconfig.Finalizer gets it added on
+// its first Reconcile, before any manifest is generated.
+func TestReconcileSetsFinalizerOnAdmission(t *testing.T) {
+	csc := &v1alpha1.CatalogSourceConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "marketplace"},
+		Spec:       v1alpha1.CatalogSourceConfigSpec{TargetNamespace: "target"},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	client := fake.NewFakeClientWithScheme(scheme, csc)
+
+	r := controller.NewReconciler(client, datastore.New())
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "marketplace", Name: "etcd"}})
+	require.NoError(t, err)
+
+	updated := &v1alpha1.CatalogSourceConfig{}
+	require.NoError(t, client.Get(goctx.TODO(), types.NamespacedName{Namespace: "marketplace", Name: "etcd"}, updated))
+	require.Contains(t, updated.GetFinalizers(), pkgcatalogsourceconfig.Finalizer)
+}
+
+// TestReconcileFinalizeRemovesConfigMapAndFinalizer checks that deleting a
+// CatalogSourceConfig with catalogsourceconfig.Finalizer set drives removal
+// of its generated ConfigMap, then clears the finalizer so the delete can
+// complete.
+func TestReconcileFinalizeRemovesConfigMapAndFinalizer(t *testing.T) {
+	now := metav1.Now()
+	csc := &v1alpha1.CatalogSourceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "etcd",
+			Namespace:         "marketplace",
+			Finalizers:        []string{pkgcatalogsourceconfig.Finalizer},
+			DeletionTimestamp: &now,
+		},
+		Spec: v1alpha1.CatalogSourceConfigSpec{TargetNamespace: "target"},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v1alpha1.ConfigMapPrefix + "etcd",
+			Namespace: "target",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+	client := fake.NewFakeClientWithScheme(scheme, csc, configMap)
+
+	r := controller.NewReconciler(client, datastore.New())
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "marketplace", Name: "etcd"}})
+	require.NoError(t, err)
+
+	err = client.Get(goctx.TODO(), types.NamespacedName{Namespace: "target", Name: configMap.GetName()}, &corev1.ConfigMap{})
+	require.True(t, apierrors.IsNotFound(err))
+
+	updated := &v1alpha1.CatalogSourceConfig{}
+	require.NoError(t, client.Get(goctx.TODO(), types.NamespacedName{Namespace: "marketplace", Name: "etcd"}, updated))
+	require.NotContains(t, updated.GetFinalizers(), pkgcatalogsourceconfig.Finalizer)
+}
+
+// pushTestBundleImage builds a single layer tarball containing files and
+// pushes it to the fake registry at serverURL, returning the image
+// reference.
+func pushTestBundleImage(t *testing.T, serverURL string, files map[string]string) string {
+	ref, err := name.ParseReference(serverURL[len("http://"):] + "/bundle:v0.9.2")
+	require.NoError(t, err)
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for name, content := range files {
+			hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+			_ = tw.WriteHeader(hdr)
+			_, _ = tw.Write([]byte(content))
+		}
+		_ = tw.Close()
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	require.NoError(t, remote.Write(ref, img))
+	return ref.Name()
+}
+
+func helperLoadFromFile(t *testing.T, filename string) *datastore.OperatorMetadata {
+	path := filepath.Join("../../testdata", filename)
+	bytes, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return &datastore.OperatorMetadata{
+		RegistryMetadata: datastore.RegistryMetadata{
+			Namespace:  "operators",
+			Repository: "redhat",
+		},
+		RawYAML: bytes,
+	}
+}
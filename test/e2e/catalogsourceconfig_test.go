@@ -11,10 +11,22 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 )
 
+// catalogSourceGVK identifies the child CatalogSource created for a
+// CatalogSourceConfig in spec.targetNamespace, matching catalogSourceGVK in
+// pkg/controller/catalogsourceconfig.
+var catalogSourceGVK = schema.GroupVersionKind{
+	Group:   "operators.coreos.com",
+	Version: "v1alpha1",
+	Kind:    "CatalogSource",
+}
+
 // Global test context that can be shared across subtests.
 var ctx *test.TestCtx
 
@@ -30,6 +42,8 @@ func TestCatalogSourceConfig(t *testing.T) {
 	// run subtests
 	t.Run("CatalogSourceConfig-group", func(t *testing.T) {
 		t.Run("Create", CatalogSourceConfigCreate)
+		t.Run("FinalizerCleansUpOnDelete", CatalogSourceConfigFinalizerCleansUpOnDelete)
+		t.Run("FinalizerSurvivesControllerRestart", CatalogSourceConfigFinalizerSurvivesControllerRestart)
 	})
 }
 
@@ -89,6 +103,236 @@ func CatalogSourceConfigCreate(t *testing.T) {
 	}
 }
 
+// CatalogSourceConfigFinalizerCleansUpOnDelete verifies that deleting a
+// CatalogSourceConfig directly -- without the test ever invoking
+// manifest.Delete() itself -- still results in the generated ConfigMap and
+// the child CatalogSource being removed, because the controller's finalizer
+// runs the cleanup on the CatalogSourceConfig's deletion. The manifest
+// directory itself lives on the marketplace-operator pod's local disk, so
+// its removal is not asserted here; TestReconcileFinalizeRemovesConfigMapAndFinalizer
+// in pkg/controller/catalogsourceconfig runs the same cleanup path but
+// asserts only the ConfigMap removal and the cleared finalizer.
+func CatalogSourceConfigFinalizerCleansUpOnDelete(t *testing.T) {
+	dclient := test.Global.DynamicClient
+	kclient := test.Global.KubeClient
+	testNamespace := getTestNamespace(t)
+
+	targetNamespace := &corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ns-csc-finalizertest",
+		},
+	}
+	err := dclient.Create(goctx.TODO(), targetNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.AddFinalizerFn(func() error {
+		return dclient.Delete(goctx.TODO(), targetNamespace)
+	})
+
+	testCatalogSourceConfigName := "finalizertest"
+	testCatalogSourceConfig := &v1alpha1.CatalogSourceConfig{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CatalogSourceConfig",
+			APIVersion: "marketplace.redhat.com/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testCatalogSourceConfigName,
+			Namespace: testNamespace,
+		},
+		Spec: v1alpha1.CatalogSourceConfigSpec{
+			TargetNamespace: targetNamespace.Name,
+		},
+	}
+	err = dclient.Create(goctx.TODO(), testCatalogSourceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedConfigMap := v1alpha1.ConfigMapPrefix + testCatalogSourceConfigName
+	err = WaitForConfigMap(t, kclient, targetNamespace.Name, expectedConfigMap, time.Second*5, time.Minute*5)
+	if err != nil {
+		t.Fatalf("Expected ConfigMap %s was not created in %s namespace", expectedConfigMap, targetNamespace.Name)
+	}
+
+	// Delete the CatalogSourceConfig directly. The finalizer set on it by the
+	// controller should drive removal of the ConfigMap and child
+	// CatalogSource before the object itself goes away.
+	if err := dclient.Delete(goctx.TODO(), testCatalogSourceConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	err = waitForCatalogSourceConfigDeleted(t, dclient, testNamespace, testCatalogSourceConfigName, time.Second*5, time.Minute*5)
+	if err != nil {
+		t.Fatalf("CatalogSourceConfig %s was not removed: %v", testCatalogSourceConfigName, err)
+	}
+
+	err = waitForConfigMapDeleted(t, kclient, targetNamespace.Name, expectedConfigMap, time.Second*5, time.Minute*5)
+	if err != nil {
+		t.Fatalf("Expected ConfigMap %s in %s namespace to be deleted by the finalizer: %v", expectedConfigMap, targetNamespace.Name, err)
+	}
+
+	err = waitForCatalogSourceDeleted(t, dclient, targetNamespace.Name, testCatalogSourceConfigName, time.Second*5, time.Minute*5)
+	if err != nil {
+		t.Fatalf("Expected CatalogSource %s in %s namespace to be deleted by the finalizer: %v", testCatalogSourceConfigName, targetNamespace.Name, err)
+	}
+}
+
+// CatalogSourceConfigFinalizerSurvivesControllerRestart verifies that the
+// finalizer set on a CatalogSourceConfig still drives cleanup of its
+// generated ConfigMap after the marketplace-operator deployment is restarted
+// between the CatalogSourceConfig's creation and its deletion -- exercising
+// the reconcile path that recomputes the manifest directory from the
+// CatalogSourceConfig's name rather than relying on in-memory state.
+func CatalogSourceConfigFinalizerSurvivesControllerRestart(t *testing.T) {
+	dclient := test.Global.DynamicClient
+	kclient := test.Global.KubeClient
+	testNamespace := getTestNamespace(t)
+
+	targetNamespace := &corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ns-csc-restarttest",
+		},
+	}
+	err := dclient.Create(goctx.TODO(), targetNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.AddFinalizerFn(func() error {
+		return dclient.Delete(goctx.TODO(), targetNamespace)
+	})
+
+	testCatalogSourceConfigName := "restarttest"
+	testCatalogSourceConfig := &v1alpha1.CatalogSourceConfig{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CatalogSourceConfig",
+			APIVersion: "marketplace.redhat.com/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testCatalogSourceConfigName,
+			Namespace: testNamespace,
+		},
+		Spec: v1alpha1.CatalogSourceConfigSpec{
+			TargetNamespace: targetNamespace.Name,
+		},
+	}
+	err = dclient.Create(goctx.TODO(), testCatalogSourceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedConfigMap := v1alpha1.ConfigMapPrefix + testCatalogSourceConfigName
+	err = WaitForConfigMap(t, kclient, targetNamespace.Name, expectedConfigMap, time.Second*5, time.Minute*5)
+	if err != nil {
+		t.Fatalf("Expected ConfigMap %s was not created in %s namespace", expectedConfigMap, targetNamespace.Name)
+	}
+
+	restartMarketplaceOperator(t, kclient, testNamespace)
+
+	if err := dclient.Delete(goctx.TODO(), testCatalogSourceConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	err = waitForConfigMapDeleted(t, kclient, targetNamespace.Name, expectedConfigMap, time.Second*5, time.Minute*5)
+	if err != nil {
+		t.Fatalf("Expected ConfigMap %s in %s namespace to be deleted by the finalizer after a controller restart: %v", expectedConfigMap, targetNamespace.Name, err)
+	}
+}
+
+// restartMarketplaceOperator scales the marketplace-operator deployment down
+// and back up to 1, and waits for it to become ready again.
+func restartMarketplaceOperator(t *testing.T, kclient kubernetes.Interface, namespace string) {
+	deployment, err := kclient.AppsV1().Deployments(namespace).Get("marketplace-operator", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var zero int32
+	deployment.Spec.Replicas = &zero
+	if _, err := kclient.AppsV1().Deployments(namespace).Update(deployment); err != nil {
+		t.Fatal(err)
+	}
+
+	err = wait.Poll(time.Second*5, time.Minute*2, func() (bool, error) {
+		d, err := kclient.AppsV1().Deployments(namespace).Get("marketplace-operator", metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return d.Status.Replicas == 0, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	one := int32(1)
+	deployment.Spec.Replicas = &one
+	if _, err := kclient.AppsV1().Deployments(namespace).Update(deployment); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e2eutil.WaitForDeployment(t, kclient, namespace, "marketplace-operator", 1, time.Second*5, time.Minute*2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForConfigMapDeleted waits until the named ConfigMap no longer exists.
+func waitForConfigMapDeleted(t *testing.T, kubeclient kubernetes.Interface, namespace, name string, retryInterval, timeout time.Duration) error {
+	return wait.Poll(retryInterval, timeout, func() (done bool, err error) {
+		_, err = kubeclient.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		t.Logf("Waiting for deletion of %s ConfigMap\n", name)
+		return false, nil
+	})
+}
+
+// waitForCatalogSourceDeleted waits until the named CatalogSource no longer
+// exists in namespace.
+func waitForCatalogSourceDeleted(t *testing.T, dclient test.FrameworkClient, namespace, name string, retryInterval, timeout time.Duration) error {
+	return wait.Poll(retryInterval, timeout, func() (done bool, err error) {
+		catalogSource := &unstructured.Unstructured{}
+		catalogSource.SetGroupVersionKind(catalogSourceGVK)
+		err = dclient.Get(goctx.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, catalogSource)
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		t.Logf("Waiting for deletion of %s CatalogSource\n", name)
+		return false, nil
+	})
+}
+
+// waitForCatalogSourceConfigDeleted waits until the named CatalogSourceConfig
+// no longer exists.
+func waitForCatalogSourceConfigDeleted(t *testing.T, dclient test.FrameworkClient, namespace, name string, retryInterval, timeout time.Duration) error {
+	return wait.Poll(retryInterval, timeout, func() (done bool, err error) {
+		csc := &v1alpha1.CatalogSourceConfig{}
+		err = dclient.Get(goctx.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, csc)
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		t.Logf("Waiting for deletion of %s CatalogSourceConfig\n", name)
+		return false, nil
+	})
+}
+
 func getTestNamespace(t *testing.T) string {
 	// Get the namespace where the operator is running
 	namespace, err := ctx.GetNamespace()